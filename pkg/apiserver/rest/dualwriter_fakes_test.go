@@ -0,0 +1,153 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/registry/rest"
+)
+
+// fakeStorage is a minimal in-memory Storage/LegacyStorage double covering
+// every method the dual writer calls, shared by this package's tests.
+type fakeStorage struct {
+	mu      sync.Mutex
+	objects map[string]*metav1.PartialObjectMetadata
+
+	createErr       error
+	updateErr       error
+	failNextCreates int
+	failNextUpdates int
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{objects: map[string]*metav1.PartialObjectMetadata{}}
+}
+
+func (f *fakeStorage) Get(_ context.Context, name string, _ *metav1.GetOptions) (runtime.Object, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.objects[name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return obj.DeepCopy(), nil
+}
+
+func (f *fakeStorage) List(_ context.Context, _ *metainternalversion.ListOptions) (runtime.Object, error) {
+	return &metav1.PartialObjectMetadataList{}, nil
+}
+
+func (f *fakeStorage) Create(_ context.Context, obj runtime.Object, _ rest.ValidateObjectFunc, _ *metav1.CreateOptions) (runtime.Object, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failNextCreates > 0 {
+		f.failNextCreates--
+		return nil, errors.New("create failed")
+	}
+	if f.createErr != nil {
+		return nil, f.createErr
+	}
+	p := obj.(*metav1.PartialObjectMetadata).DeepCopy()
+	f.objects[p.Name] = p
+	return p, nil
+}
+
+func (f *fakeStorage) Update(ctx context.Context, name string, objInfo rest.UpdatedObjectInfo, _ rest.ValidateObjectFunc, _ rest.ValidateObjectUpdateFunc, _ bool, _ *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	f.mu.Lock()
+	current, ok := f.objects[name]
+	f.mu.Unlock()
+
+	var currentObj runtime.Object
+	if ok {
+		currentObj = current.DeepCopy()
+	} else {
+		currentObj = &metav1.PartialObjectMetadata{}
+	}
+
+	updated, err := objInfo.UpdatedObject(ctx, currentObj)
+	if err != nil {
+		return nil, false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failNextUpdates > 0 {
+		f.failNextUpdates--
+		return nil, false, errors.New("update failed")
+	}
+	if f.updateErr != nil {
+		return nil, false, f.updateErr
+	}
+	p := updated.(*metav1.PartialObjectMetadata).DeepCopy()
+	p.Name = name
+	f.objects[name] = p
+	return p, false, nil
+}
+
+func (f *fakeStorage) Delete(_ context.Context, name string, _ rest.ValidateObjectFunc, _ *metav1.DeleteOptions) (runtime.Object, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.objects, name)
+	return &metav1.PartialObjectMetadata{}, false, nil
+}
+
+func (f *fakeStorage) DeleteCollection(_ context.Context, _ rest.ValidateObjectFunc, _ *metav1.DeleteOptions, _ *metainternalversion.ListOptions) (runtime.Object, error) {
+	return &metav1.PartialObjectMetadataList{}, nil
+}
+
+func (f *fakeStorage) New() runtime.Object     { return &metav1.PartialObjectMetadata{} }
+func (f *fakeStorage) NewList() runtime.Object { return &metav1.PartialObjectMetadataList{} }
+func (f *fakeStorage) Destroy()                {}
+func (f *fakeStorage) GetSingularName() string { return "thing" }
+func (f *fakeStorage) NamespaceScoped() bool   { return true }
+
+func (f *fakeStorage) ConvertToTable(_ context.Context, _ runtime.Object, _ runtime.Object) (*metav1.Table, error) {
+	return &metav1.Table{}, nil
+}
+
+// fakeShadowWriteStore is an in-memory ShadowWriteStore double.
+type fakeShadowWriteStore struct {
+	mu           sync.Mutex
+	persisted    map[string]shadowWriteItem
+	completed    []string
+	deadLettered []shadowWriteItem
+	pending      []shadowWriteItem
+}
+
+func (s *fakeShadowWriteStore) Persist(_ context.Context, item shadowWriteItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.persisted == nil {
+		s.persisted = map[string]shadowWriteItem{}
+	}
+	s.persisted[item.ID] = item
+	return nil
+}
+
+func (s *fakeShadowWriteStore) Complete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.persisted, id)
+	s.completed = append(s.completed, id)
+	return nil
+}
+
+func (s *fakeShadowWriteStore) DeadLetter(_ context.Context, item shadowWriteItem, _ error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.persisted, item.ID)
+	s.deadLettered = append(s.deadLettered, item)
+	return nil
+}
+
+func (s *fakeShadowWriteStore) Pending(_ context.Context) ([]shadowWriteItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]shadowWriteItem, len(s.pending))
+	copy(out, s.pending)
+	return out, nil
+}
@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/trace"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+const (
+	shadowWriteCanceledRequestClosed = "request_closed"
+	shadowWriteCanceledShutdown      = "shutdown"
+	shadowWriteCanceledTimeout       = "timeout"
+)
+
+var dualwriterShadowWriteCanceledTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "dualwriter",
+	Name:      "shadow_write_canceled_total",
+	Help:      "Number of shadow writes that did not complete, by why they were canceled.",
+}, []string{"reason"})
+
+// dualWriterLifecycle owns the long-lived context that shadow writes run
+// against, independent of any single request. Without it, every `go
+// func()` fired by a DualWriter mode derives its timeout from the inbound
+// HTTP request's own context: as soon as the handler returns the response,
+// that context is canceled and the shadow write to Storage is aborted
+// mid-flight. A lifecycle's parent context is only canceled by Stop,
+// which DualWriter.Destroy calls, so shadow writes survive the request
+// that triggered them and are only bounded by their own budget.
+type dualWriterLifecycle struct {
+	parent context.Context
+	cancel context.CancelFunc
+}
+
+// newDualWriterLifecycle creates a lifecycle whose parent context lives
+// until Stop is called.
+func newDualWriterLifecycle() *dualWriterLifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &dualWriterLifecycle{parent: ctx, cancel: cancel}
+}
+
+// Detach returns a context derived from the lifecycle's long-lived parent,
+// bounded by budget and cause independent of reqCtx's own cancellation.
+// It carries forward the parts of reqCtx a shadow write legitimately
+// needs -- the acting user, the originating audit ID, and a link back to
+// the originating trace span for correlation -- by explicit copy, never
+// by reparenting onto reqCtx itself.
+func (l *dualWriterLifecycle) Detach(reqCtx context.Context, budget time.Duration, cause error) (context.Context, context.CancelFunc) {
+	ctx := l.parent
+	if user, ok := genericapirequest.UserFrom(reqCtx); ok {
+		ctx = genericapirequest.WithUser(ctx, user)
+	}
+	if auditID, ok := genericapirequest.AuditIDFrom(reqCtx); ok {
+		ctx = genericapirequest.WithAuditID(ctx, auditID)
+	}
+	if span := trace.SpanContextFromContext(reqCtx); span.IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, span)
+	}
+	return context.WithTimeoutCause(ctx, budget, cause)
+}
+
+// Stop cancels the lifecycle's parent context, terminating every shadow
+// write still running against it. DualWriter.Destroy calls this so
+// in-flight work is given a chance to notice shutdown rather than leak.
+func (l *dualWriterLifecycle) Stop() {
+	l.cancel()
+}
+
+// classifyShadowWriteCancellation buckets why a shadow write didn't
+// complete for the dualwriter_shadow_write_canceled_total{reason} metric.
+// detached should be true when the write ran on a dualWriterLifecycle
+// context (so a Canceled error can only mean the lifecycle was stopped,
+// i.e. apiserver shutdown) and false when it still ran on a request-scoped
+// context (so a Canceled error means the caller's request ended).
+func classifyShadowWriteCancellation(err error, detached bool) (string, bool) {
+	switch {
+	case err == nil:
+		return "", false
+	case errors.Is(err, context.DeadlineExceeded):
+		return shadowWriteCanceledTimeout, true
+	case errors.Is(err, context.Canceled):
+		if detached {
+			return shadowWriteCanceledShutdown, true
+		}
+		return shadowWriteCanceledRequestClosed, true
+	default:
+		return "", false
+	}
+}
+
+// recordShadowWriteCanceled records the outcome of classifyShadowWriteCancellation, if any.
+func recordShadowWriteCanceled(err error, detached bool) {
+	if reason, canceled := classifyShadowWriteCancellation(err, detached); canceled {
+		dualwriterShadowWriteCanceledTotal.WithLabelValues(reason).Inc()
+	}
+}
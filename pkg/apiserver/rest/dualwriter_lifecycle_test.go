@@ -0,0 +1,90 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func TestDualWriterLifecycleDetachCarriesUserAndAuditID(t *testing.T) {
+	l := newDualWriterLifecycle()
+	defer l.Stop()
+
+	reqCtx := genericapirequest.WithUser(context.Background(), &user.DefaultInfo{Name: "alice"})
+	reqCtx = genericapirequest.WithAuditID(reqCtx, types.UID("audit-123"))
+
+	ctx, cancel := l.Detach(reqCtx, time.Second, errors.New("test timeout"))
+	defer cancel()
+
+	gotUser, ok := genericapirequest.UserFrom(ctx)
+	if !ok || gotUser.GetName() != "alice" {
+		t.Fatalf("expected the acting user to be carried forward, got %+v, ok=%v", gotUser, ok)
+	}
+
+	gotAuditID, ok := genericapirequest.AuditIDFrom(ctx)
+	if !ok || gotAuditID != "audit-123" {
+		t.Fatalf("expected the audit ID to be carried forward, got %q, ok=%v", gotAuditID, ok)
+	}
+}
+
+func TestDualWriterLifecycleDetachSurvivesRequestCancellation(t *testing.T) {
+	l := newDualWriterLifecycle()
+	defer l.Stop()
+
+	reqCtx, reqCancel := context.WithCancel(context.Background())
+	ctx, cancel := l.Detach(reqCtx, time.Second, errors.New("test timeout"))
+	defer cancel()
+
+	reqCancel()
+
+	select {
+	case <-ctx.Done():
+		t.Fatalf("detached context should not be canceled when the originating request is canceled")
+	default:
+	}
+}
+
+func TestDualWriterLifecycleStopCancelsDetachedContexts(t *testing.T) {
+	l := newDualWriterLifecycle()
+	ctx, cancel := l.Detach(context.Background(), time.Minute, errors.New("test timeout"))
+	defer cancel()
+
+	l.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("expected Stop to cancel contexts derived from the lifecycle")
+	}
+}
+
+func TestClassifyShadowWriteCancellation(t *testing.T) {
+	cases := []struct {
+		name         string
+		err          error
+		detached     bool
+		wantReason   string
+		wantCanceled bool
+	}{
+		{"nil error", nil, true, "", false},
+		{"deadline exceeded", context.DeadlineExceeded, true, shadowWriteCanceledTimeout, true},
+		{"canceled while detached", context.Canceled, true, shadowWriteCanceledShutdown, true},
+		{"canceled on request context", context.Canceled, false, shadowWriteCanceledRequestClosed, true},
+		{"other error", errors.New("boom"), true, "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reason, canceled := classifyShadowWriteCancellation(tc.err, tc.detached)
+			if canceled != tc.wantCanceled || reason != tc.wantReason {
+				t.Fatalf("classifyShadowWriteCancellation(%v, %v) = (%q, %v), want (%q, %v)",
+					tc.err, tc.detached, reason, canceled, tc.wantReason, tc.wantCanceled)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/registry/rest"
 	"k8s.io/klog/v2"
 )
@@ -19,16 +20,67 @@ type DualWriterMode1 struct {
 	Storage Storage
 	Log     klog.Logger
 	*dualWriterMetrics
+
+	shadowQueue    *ShadowWriteQueue
+	reconciler     Reconciler
+	reconcilerStop context.CancelFunc
+	lifecycle      *dualWriterLifecycle
 }
 
 var mode = strconv.Itoa(int(Mode1))
 
+// DualWriterOption configures optional DualWriterMode1 behavior beyond
+// the required LegacyStorage/Storage pair. DualWriterMode2 takes no
+// options.
+type DualWriterOption func(*DualWriterMode1)
+
+// WithReconciler attaches a background drift Reconciler that runs for as
+// long as the DualWriter is alive, stopping when Destroy is called. Callers
+// decide per-Kind whether to wire one in, which is the allow-list: Kinds
+// left out of the wiring simply never get a Reconciler constructed.
+func WithReconciler(reconciler Reconciler) DualWriterOption {
+	return func(d *DualWriterMode1) {
+		d.reconciler = reconciler
+	}
+}
+
 // NewDualWriterMode1 returns a new DualWriter in mode 1.
-// Mode 1 represents writing to and reading from LegacyStorage.
-func NewDualWriterMode1(legacy LegacyStorage, storage Storage) *DualWriterMode1 {
+// Mode 1 represents writing to and reading from LegacyStorage. Create,
+// Update and Delete are additionally queued as shadow writes against
+// storage: rather than firing a goroutine tied to the inbound request
+// context, the write is enqueued onto queue, a persistent, rate-limited
+// ShadowWriteQueue whose workers survive the request and retry with
+// backoff on failure. DeleteCollection is not queued; it is replayed
+// against storage from a goroutine on a detached context, without retry.
+// queue is shared across every
+// DualWriterMode1/ModeCompare instance built against the same
+// Storage -- build one with NewShadowWriteQueue per Storage and pass it
+// to every DualWriter wrapping that Storage, rather than building a queue
+// per call, so every Kind drains through the same bounded worker pool
+// instead of each getting its own. NewDualWriterMode1 calls queue.Start,
+// which is idempotent, so callers don't need to start it themselves.
+func NewDualWriterMode1(legacy LegacyStorage, storage Storage, queue *ShadowWriteQueue, opts ...DualWriterOption) *DualWriterMode1 {
 	metrics := &dualWriterMetrics{}
 	metrics.init()
-	return &DualWriterMode1{Legacy: legacy, Storage: storage, Log: klog.NewKlogr().WithName("DualWriterMode1"), dualWriterMetrics: metrics}
+	lifecycle := newDualWriterLifecycle()
+	queue.Start()
+	d := &DualWriterMode1{
+		Legacy:            legacy,
+		Storage:           storage,
+		Log:               klog.NewKlogr().WithName("DualWriterMode1"),
+		dualWriterMetrics: metrics,
+		shadowQueue:       queue,
+		lifecycle:         lifecycle,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.reconciler != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		d.reconcilerStop = cancel
+		go d.reconciler.Run(ctx)
+	}
+	return d
 }
 
 // Create overrides the behavior of the generic DualWriter and writes only to LegacyStorage.
@@ -58,12 +110,9 @@ func (d *DualWriterMode1) Create(ctx context.Context, obj runtime.Object, create
 
 	enrichObject(accessorOld, accessorCreated)
 
-	go func() {
-		startStorage := time.Now().UTC()
-		ctx, _ := context.WithTimeoutCause(ctx, time.Second*10, errors.New("storage create timeout"))
-		_, err := d.Storage.Create(ctx, obj, createValidation, options)
-		defer d.recordStorageDuration(err != nil, mode, options.Kind, method, startStorage)
-	}()
+	if err := d.shadowQueue.EnqueueObject(ctx, shadowWriteCreate, options.Kind, accessorCreated.GetNamespace(), accessorCreated.GetName(), accessorCreated.GetResourceVersion(), res); err != nil {
+		log.Error(err, "unable to enqueue shadow create")
+	}
 
 	return res, err
 }
@@ -85,8 +134,10 @@ func (d *DualWriterMode1) Get(ctx context.Context, name string, options *metav1.
 
 	go func() {
 		startStorage := time.Now().UTC()
-		ctx, _ := context.WithTimeoutCause(ctx, time.Second*10, errors.New("storage get timeout"))
-		_, err := d.Storage.Get(ctx, name, options)
+		shadowCtx, cancel := d.lifecycle.Detach(ctx, time.Second*10, errors.New("storage get timeout"))
+		defer cancel()
+		_, err := d.Storage.Get(shadowCtx, name, options)
+		recordShadowWriteCanceled(err, true)
 		defer d.recordStorageDuration(err != nil, mode, name, method, startStorage)
 	}()
 
@@ -110,8 +161,10 @@ func (d *DualWriterMode1) List(ctx context.Context, options *metainternalversion
 
 	go func() {
 		startStorage := time.Now().UTC()
-		ctx, _ := context.WithTimeoutCause(ctx, time.Second*10, errors.New("storage list timeout"))
-		_, err := d.Storage.List(ctx, options)
+		shadowCtx, cancel := d.lifecycle.Detach(ctx, time.Second*10, errors.New("storage list timeout"))
+		defer cancel()
+		_, err := d.Storage.List(shadowCtx, options)
+		recordShadowWriteCanceled(err, true)
 		defer d.recordStorageDuration(err != nil, mode, options.Kind, method, startStorage)
 	}()
 
@@ -132,12 +185,20 @@ func (d *DualWriterMode1) Delete(ctx context.Context, name string, deleteValidat
 	}
 	d.recordLegacyDuration(false, mode, name, method, startLegacy)
 
-	go func() {
-		startStorage := time.Now().UTC()
-		ctx, _ := context.WithTimeoutCause(ctx, time.Second*10, errors.New("storage delete timeout"))
-		_, _, err := d.Storage.Delete(ctx, name, deleteValidation, options)
-		defer d.recordStorageDuration(err != nil, mode, name, method, startStorage)
-	}()
+	// Namespace comes from the request context rather than res: some
+	// Legacy.Delete implementations return a minimal status object that
+	// doesn't carry it, and without it this item would share
+	// EnqueueObject's kind/namespace/name@resourceVersion ID with an
+	// unrelated object of the same name in a different namespace.
+	namespace, _ := genericapirequest.NamespaceFrom(ctx)
+	accessorRes, err := meta.Accessor(res)
+	if err != nil {
+		log.Error(err, "unable to get accessor for deleted object")
+	}
+
+	if err := d.shadowQueue.EnqueueObject(ctx, shadowWriteDelete, options.Kind, namespace, name, accessorRes.GetResourceVersion(), res); err != nil {
+		log.Error(err, "unable to enqueue shadow delete")
+	}
 
 	return res, async, err
 }
@@ -158,8 +219,10 @@ func (d *DualWriterMode1) DeleteCollection(ctx context.Context, deleteValidation
 
 	go func() {
 		startStorage := time.Now().UTC()
-		ctx, _ := context.WithTimeoutCause(ctx, time.Second*10, errors.New("storage deletecollection timeout"))
-		_, err := d.Storage.DeleteCollection(ctx, deleteValidation, options, listOptions)
+		shadowCtx, cancel := d.lifecycle.Detach(ctx, time.Second*10, errors.New("storage deletecollection timeout"))
+		defer cancel()
+		_, err := d.Storage.DeleteCollection(shadowCtx, deleteValidation, options, listOptions)
+		recordShadowWriteCanceled(err, true)
 		defer d.recordStorageDuration(err != nil, mode, options.Kind, method, startStorage)
 	}()
 
@@ -179,55 +242,34 @@ func (d *DualWriterMode1) Update(ctx context.Context, name string, objInfo rest.
 	}
 	d.recordLegacyDuration(false, mode, name, method, startLegacy)
 
-	updated, err := objInfo.UpdatedObject(ctx, res)
-	if err != nil {
-		log.WithValues("object", updated).Error(err, "could not update or create object")
-	}
-
-	// get the object to be updated
-	old, err := d.Storage.Get(ctx, name, &metav1.GetOptions{})
+	accessorRes, err := meta.Accessor(res)
 	if err != nil {
-		log.WithValues("object", old).Error(err, "could not get object to update")
+		log.Error(err, "unable to get accessor for updated object")
 	}
 
-	// if the object is found, create a new updateWrapper with the object found
-	if old != nil {
-		objInfo = &updateWrapper{
-			upstream: objInfo,
-			updated:  old,
-		}
-
-		accessorOld, err := meta.Accessor(old)
-		if err != nil {
-			log.Error(err, "unable to get accessor for original updated object")
-		}
-
-		accessor, err := meta.Accessor(res)
-		if err != nil {
-			log.Error(err, "unable to get accessor for updated object")
-		}
-
-		accessor.SetResourceVersion(accessorOld.GetResourceVersion())
-		accessor.SetUID(accessorOld.GetUID())
-
-		enrichObject(accessorOld, accessor)
-		objInfo = &updateWrapper{
-			upstream: objInfo,
-			updated:  res,
-		}
+	// res is already the fully-resolved object Legacy.Update produced by
+	// running objInfo against the prior state exactly once. Shadow-write
+	// res itself rather than invoking objInfo.UpdatedObject again: for a
+	// non-idempotent UpdatedObjectInfo (JSON patch, strategic merge with
+	// list-append, counters, generation/finalizer bumps) a second
+	// invocation would re-apply the patch on top of an already-updated
+	// object and persist a corrupted result to Storage.
+	if err := d.shadowQueue.EnqueueObject(ctx, shadowWriteUpdate, options.Kind, accessorRes.GetNamespace(), name, accessorRes.GetResourceVersion(), res); err != nil {
+		log.Error(err, "unable to enqueue shadow update")
 	}
 
-	go func() {
-		startStorage := time.Now().UTC()
-		ctx, _ := context.WithTimeoutCause(ctx, time.Second*10, errors.New("storage update timeout"))
-		_, _, err := d.Storage.Update(ctx, name, objInfo, createValidation, updateValidation, forceAllowCreate, options)
-		defer d.recordStorageDuration(err != nil, mode, name, method, startStorage)
-	}()
-
 	return res, async, errLegacy
 }
 
+// Destroy stops this instance's own reconciler and the lifecycle behind
+// its detached Get/List/DeleteCollection calls. It does not stop shadowQueue: that queue is shared with
+// every other DualWriter instance built against the same Storage, and is
+// stopped by whoever constructed it, not by any one instance's Destroy.
 func (d *DualWriterMode1) Destroy() {
+	if d.reconcilerStop != nil {
+		d.reconcilerStop()
+	}
+	d.lifecycle.Stop()
 	d.Storage.Destroy()
 	d.Legacy.Destroy()
 }
@@ -0,0 +1,380 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/klog/v2"
+)
+
+// modeCompare labels metrics emitted by DualWriterModeCompare, mirroring
+// how the numeric DualWriterMode constants label Mode1/Mode2/etc.
+const modeCompare = "compare"
+
+var (
+	dualwriterReadMismatchTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dualwriter",
+		Name:      "read_mismatch_total",
+		Help:      "Number of reads where Legacy and Storage disagreed, by kind and the top divergent JSON field path.",
+	}, []string{"kind", "field"})
+)
+
+// defaultCompareSampleRate is the fraction of mismatched payloads that are
+// retained in the debug ring buffer. NewDualWriterModeCompare always uses
+// it; the constructor takes no sample rate.
+const defaultCompareSampleRate = 0.1
+
+// defaultCompareRingBufferSize bounds memory used by the sampled-mismatch
+// ring buffer exposed through the admin debug endpoint.
+const defaultCompareRingBufferSize = 256
+
+// defaultCompareTokensPerSecond caps how many comparisons a ModeCompare instance
+// may perform per second, so a listing storm on a large Kind cannot
+// starve the apiserver doing diff work instead of serving requests.
+const defaultCompareTokensPerSecond = 50
+
+// DualWriterModeCompare fans Get/List/ConvertToTable out to both Legacy
+// and Storage, returns the Legacy result on the hot path (matching Mode
+// 2's read-from-legacy, dual-write semantics), and asynchronously diffs
+// the two responses so operators can validate Storage before cutting
+// reads over to it.
+type DualWriterModeCompare struct {
+	Legacy  LegacyStorage
+	Storage Storage
+	Log     klog.Logger
+	*dualWriterMetrics
+
+	// writer handles Create/Update/Delete/DeleteCollection, which behave
+	// like Mode 2: dual-write with Legacy authoritative.
+	writer *DualWriterMode1
+
+	sampleRate float64
+	tokens     *compareTokenBucket
+	mismatches *mismatchRingBuffer
+}
+
+// NewDualWriterModeCompare returns a new DualWriter in read-comparison
+// mode. Writes behave like Mode 2 (dual-write, legacy authoritative);
+// reads are served from Legacy and compared against Storage off the hot
+// path. queue is the shared ShadowWriteQueue for this Storage -- see
+// NewDualWriterMode1.
+func NewDualWriterModeCompare(legacy LegacyStorage, storage Storage, queue *ShadowWriteQueue) *DualWriterModeCompare {
+	writer := NewDualWriterMode1(legacy, storage, queue)
+	return &DualWriterModeCompare{
+		Legacy:            legacy,
+		Storage:           storage,
+		Log:               klog.NewKlogr().WithName("DualWriterModeCompare"),
+		dualWriterMetrics: writer.dualWriterMetrics,
+		writer:            writer,
+		sampleRate:        defaultCompareSampleRate,
+		tokens:            newCompareTokenBucket(defaultCompareTokensPerSecond),
+		mismatches:        newMismatchRingBuffer(defaultCompareRingBufferSize),
+	}
+}
+
+// Get reads from Legacy and asynchronously compares the result against Storage.
+func (d *DualWriterModeCompare) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+	log := d.Log.WithValues("name", name, "kind", options.Kind)
+	ctx = klog.NewContext(ctx, log)
+
+	startLegacy := time.Now().UTC()
+	res, err := d.Legacy.Get(ctx, name, options)
+	if err != nil {
+		log.Error(err, "unable to get object in legacy storage")
+		d.recordLegacyDuration(true, modeCompare, options.Kind, "get", startLegacy)
+		return res, err
+	}
+	d.recordLegacyDuration(false, modeCompare, options.Kind, "get", startLegacy)
+
+	d.compareAsync(context.WithoutCancel(ctx), options.Kind, func(cmpCtx context.Context) (runtime.Object, runtime.Object, error) {
+		storageRes, err := d.Storage.Get(cmpCtx, name, options)
+		return res, storageRes, err
+	})
+
+	return res, nil
+}
+
+// List reads from Legacy and asynchronously compares the result against Storage.
+func (d *DualWriterModeCompare) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	log := d.Log.WithValues("kind", options.Kind)
+	ctx = klog.NewContext(ctx, log)
+
+	startLegacy := time.Now().UTC()
+	res, err := d.Legacy.List(ctx, options)
+	if err != nil {
+		log.Error(err, "unable to list object in legacy storage")
+		d.recordLegacyDuration(true, modeCompare, options.Kind, "list", startLegacy)
+		return res, err
+	}
+	d.recordLegacyDuration(false, modeCompare, options.Kind, "list", startLegacy)
+
+	d.compareAsync(context.WithoutCancel(ctx), options.Kind, func(cmpCtx context.Context) (runtime.Object, runtime.Object, error) {
+		storageRes, err := d.Storage.List(cmpCtx, options)
+		return res, storageRes, err
+	})
+
+	return res, nil
+}
+
+// ConvertToTable reads from Legacy and asynchronously compares the result
+// against Storage, same as Get and List.
+func (d *DualWriterModeCompare) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
+	kind := object.GetObjectKind().GroupVersionKind().Kind
+	log := d.Log.WithValues("kind", kind)
+
+	res, err := d.Legacy.ConvertToTable(ctx, object, tableOptions)
+	if err != nil {
+		log.Error(err, "unable to convert to table in legacy storage")
+		return res, err
+	}
+
+	d.compareAsync(context.WithoutCancel(ctx), kind, func(cmpCtx context.Context) (runtime.Object, runtime.Object, error) {
+		storageRes, err := d.Storage.ConvertToTable(cmpCtx, object, tableOptions)
+		return res, storageRes, err
+	})
+
+	return res, nil
+}
+
+// compareAsync runs fetchStorage off the hot path, subject to the token
+// bucket budget, and records a mismatch if the two results disagree
+// after stripping volatile metadata.
+func (d *DualWriterModeCompare) compareAsync(ctx context.Context, kind string, fetchStorage func(context.Context) (legacy, storage runtime.Object, err error)) {
+	if !d.tokens.TryTake() {
+		d.Log.V(1).Info("dropping read comparison, token bucket exhausted", "kind", kind)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		legacyObj, storageObj, err := fetchStorage(ctx)
+		if err != nil {
+			d.Log.Error(err, "unable to fetch from storage for read comparison", "kind", kind)
+			return
+		}
+
+		field, mismatched := firstMismatchedField(legacyObj, storageObj)
+		if !mismatched {
+			return
+		}
+
+		dualwriterReadMismatchTotal.WithLabelValues(kind, field).Inc()
+
+		if sampleRNG() < d.sampleRate {
+			d.mismatches.Add(mismatchSample{
+				Kind:      kind,
+				Field:     field,
+				Legacy:    legacyObj,
+				Storage:   storageObj,
+				Timestamp: time.Now().UTC(),
+			})
+		}
+	}()
+}
+
+// firstMismatchedField compares legacy and storage after stripping
+// volatile metadata and returns a JSON path where they diverge. When
+// several paths diverge, which one is returned is not defined.
+func firstMismatchedField(legacy, storage runtime.Object) (string, bool) {
+	legacyStripped, errA := stripVolatileMetadata(legacy)
+	storageStripped, errB := stripVolatileMetadata(storage)
+	if errA != nil || errB != nil {
+		return "", false
+	}
+
+	var legacyMap, storageMap map[string]interface{}
+	if err := json.Unmarshal(legacyStripped, &legacyMap); err != nil {
+		return "", false
+	}
+	if err := json.Unmarshal(storageStripped, &storageMap); err != nil {
+		return "", false
+	}
+
+	return diffPaths("", legacyMap, storageMap)
+}
+
+// diffPaths walks a and b in lock-step and returns the first path at
+// which they diverge, in Go's random map iteration order.
+func diffPaths(prefix string, a, b interface{}) (string, bool) {
+	aJSON, _ := json.Marshal(a)
+	bJSON, _ := json.Marshal(b)
+	if string(aJSON) == string(bJSON) {
+		return "", false
+	}
+
+	aMap, aOK := a.(map[string]interface{})
+	bMap, bOK := b.(map[string]interface{})
+	if !aOK || !bOK {
+		return prefix, true
+	}
+
+	for key, aVal := range aMap {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		bVal, ok := bMap[key]
+		if !ok {
+			return path, true
+		}
+		if field, mismatched := diffPaths(path, aVal, bVal); mismatched {
+			return field, true
+		}
+	}
+	for key := range bMap {
+		if _, ok := aMap[key]; !ok {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// mismatchSample is one sampled mismatched read, retained for operators to
+// inspect through the admin debug endpoint.
+type mismatchSample struct {
+	Kind      string
+	Field     string
+	Legacy    runtime.Object
+	Storage   runtime.Object
+	Timestamp time.Time
+}
+
+// mismatchRingBuffer retains up to capacity sampled mismatches, evicting
+// the oldest entry once full.
+type mismatchRingBuffer struct {
+	mu       sync.Mutex
+	entries  []mismatchSample
+	capacity int
+	next     int
+}
+
+func newMismatchRingBuffer(capacity int) *mismatchRingBuffer {
+	return &mismatchRingBuffer{capacity: capacity}
+}
+
+func (b *mismatchRingBuffer) Add(s mismatchSample) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.entries) < b.capacity {
+		b.entries = append(b.entries, s)
+		return
+	}
+	b.entries[b.next] = s
+	b.next = (b.next + 1) % b.capacity
+}
+
+// Samples returns a snapshot of the currently retained mismatches, for the
+// admin debug endpoint to render.
+func (b *mismatchRingBuffer) Samples() []mismatchSample {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]mismatchSample, len(b.entries))
+	copy(out, b.entries)
+	return out
+}
+
+// DebugHandler returns the currently sampled mismatches as JSON, intended
+// to be mounted on an admin-only debug endpoint.
+func (d *DualWriterModeCompare) DebugHandler() ([]byte, error) {
+	samples := d.mismatches.Samples()
+	return json.Marshal(samples)
+}
+
+// compareTokenBucket caps how much CPU read comparison may consume,
+// independent of the ShadowWriteQueue's retry backoff elsewhere in the
+// dual writer.
+type compareTokenBucket struct {
+	mu         sync.Mutex
+	tokens     float64
+	maxTokens  float64
+	refillRate float64
+	last       time.Time
+}
+
+func newCompareTokenBucket(perSecond int) *compareTokenBucket {
+	return &compareTokenBucket{
+		tokens:     float64(perSecond),
+		maxTokens:  float64(perSecond),
+		refillRate: float64(perSecond),
+		last:       time.Now().UTC(),
+	}
+}
+
+func (b *compareTokenBucket) TryTake() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now().UTC()
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	b.tokens = minFloat(b.maxTokens, b.tokens+elapsed*b.refillRate)
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// sampleRNG is a package-level seam so tests can make sampling deterministic.
+var sampleRNG = rand.Float64
+
+func (d *DualWriterModeCompare) Create(ctx context.Context, obj runtime.Object, createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	return d.writer.Create(ctx, obj, createValidation, options)
+}
+
+func (d *DualWriterModeCompare) Update(ctx context.Context, name string, objInfo rest.UpdatedObjectInfo, createValidation rest.ValidateObjectFunc, updateValidation rest.ValidateObjectUpdateFunc, forceAllowCreate bool, options *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	return d.writer.Update(ctx, name, objInfo, createValidation, updateValidation, forceAllowCreate, options)
+}
+
+func (d *DualWriterModeCompare) Delete(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
+	return d.writer.Delete(ctx, name, deleteValidation, options)
+}
+
+func (d *DualWriterModeCompare) DeleteCollection(ctx context.Context, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions, listOptions *metainternalversion.ListOptions) (runtime.Object, error) {
+	return d.writer.DeleteCollection(ctx, deleteValidation, options, listOptions)
+}
+
+func (d *DualWriterModeCompare) Destroy() {
+	d.writer.Destroy()
+}
+
+func (d *DualWriterModeCompare) GetSingularName() string {
+	return d.Legacy.GetSingularName()
+}
+
+func (d *DualWriterModeCompare) NamespaceScoped() bool {
+	return d.Legacy.NamespaceScoped()
+}
+
+func (d *DualWriterModeCompare) New() runtime.Object {
+	return d.Legacy.New()
+}
+
+func (d *DualWriterModeCompare) NewList() runtime.Object {
+	return d.Storage.NewList()
+}
+
+var _ rest.Storage = (*DualWriterModeCompare)(nil)
@@ -0,0 +1,95 @@
+package rest
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDiffPathsNoMismatch(t *testing.T) {
+	a := map[string]interface{}{"spec": map[string]interface{}{"title": "x"}}
+	b := map[string]interface{}{"spec": map[string]interface{}{"title": "x"}}
+	if _, mismatched := diffPaths("", a, b); mismatched {
+		t.Fatalf("identical maps should not be reported as mismatched")
+	}
+}
+
+func TestDiffPathsReportsFirstDivergentPath(t *testing.T) {
+	a := map[string]interface{}{"spec": map[string]interface{}{"title": "x", "count": float64(1)}}
+	b := map[string]interface{}{"spec": map[string]interface{}{"title": "y", "count": float64(1)}}
+	field, mismatched := diffPaths("", a, b)
+	if !mismatched {
+		t.Fatalf("expected a mismatch")
+	}
+	if field != "spec.title" {
+		t.Fatalf("field = %q, want %q", field, "spec.title")
+	}
+}
+
+func TestDiffPathsReportsMissingKey(t *testing.T) {
+	a := map[string]interface{}{"spec": map[string]interface{}{"title": "x"}}
+	b := map[string]interface{}{}
+	field, mismatched := diffPaths("", a, b)
+	if !mismatched || field != "spec" {
+		t.Fatalf("diffPaths = (%q, %v), want (\"spec\", true)", field, mismatched)
+	}
+}
+
+func TestFirstMismatchedFieldIgnoresBookkeepingAnnotation(t *testing.T) {
+	legacy := newTestObject("a", nil)
+	storage := newTestObject("a", map[string]string{lastDualWriterAppliedAnnotation: `{"x":1}`})
+
+	if _, mismatched := firstMismatchedField(legacy, storage); mismatched {
+		t.Fatalf("objects differing only by the bookkeeping annotation should not be reported as mismatched")
+	}
+}
+
+func TestCompareTokenBucketExhaustsAndRefills(t *testing.T) {
+	b := newCompareTokenBucket(1)
+	if !b.TryTake() {
+		t.Fatalf("first TryTake should succeed with a fresh bucket")
+	}
+	if b.TryTake() {
+		t.Fatalf("second immediate TryTake should fail, bucket should be exhausted")
+	}
+
+	b.last = b.last.Add(-2 * time.Second)
+	if !b.TryTake() {
+		t.Fatalf("TryTake should succeed again once the bucket has had time to refill")
+	}
+}
+
+func TestMismatchRingBufferEvictsOldest(t *testing.T) {
+	buf := newMismatchRingBuffer(2)
+	buf.Add(mismatchSample{Field: "a"})
+	buf.Add(mismatchSample{Field: "b"})
+	buf.Add(mismatchSample{Field: "c"})
+
+	samples := buf.Samples()
+	if len(samples) != 2 {
+		t.Fatalf("len(samples) = %d, want 2", len(samples))
+	}
+	for _, s := range samples {
+		if s.Field == "a" {
+			t.Fatalf("oldest sample should have been evicted, found %+v", s)
+		}
+	}
+}
+
+func TestDualWriterModeCompareConvertToTableComparesAgainstStorage(t *testing.T) {
+	legacy := newFakeStorage()
+	storage := newFakeStorage()
+	store := &fakeShadowWriteStore{}
+
+	d := NewDualWriterModeCompare(legacy, storage, NewShadowWriteQueue(storage, store, 1, nil))
+	d.tokens = newCompareTokenBucket(1000)
+
+	obj := newTestObject("a", nil)
+	tbl, err := d.ConvertToTable(context.Background(), obj, nil)
+	if err != nil {
+		t.Fatalf("ConvertToTable: %v", err)
+	}
+	if tbl == nil {
+		t.Fatalf("expected a non-nil table")
+	}
+}
@@ -0,0 +1,372 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// defaultShadowWriteWorkers is the number of goroutines draining a
+// ShadowWriteQueue when a caller doesn't need a different worker count.
+// A single queue (and its worker pool) is meant to be shared across every
+// DualWriterMode1/ModeCompare instance built against the same
+// Storage, so this bounds total shadow-write concurrency for that
+// Storage regardless of how many Kinds write through it.
+const defaultShadowWriteWorkers = 4
+
+// shadowWriteOp identifies the mutating operation a shadow write item
+// replays against Storage.
+type shadowWriteOp string
+
+const (
+	shadowWriteCreate shadowWriteOp = "create"
+	shadowWriteUpdate shadowWriteOp = "update"
+	shadowWriteDelete shadowWriteOp = "delete"
+)
+
+// maxShadowWriteAttempts bounds how many times the queue retries an item
+// against Storage before it is parked in the dead letter table.
+const maxShadowWriteAttempts = 16
+
+// shadowWriteItem is a single queued mutation to replay against Storage.
+// It is self-contained (the object is serialized) so it can survive an
+// apiserver restart once persisted via ShadowWriteStore.
+type shadowWriteItem struct {
+	ID              string        `json:"id"`
+	Op              shadowWriteOp `json:"op"`
+	Kind            string        `json:"kind"`
+	Namespace       string        `json:"namespace"`
+	Name            string        `json:"name"`
+	ResourceVersion string        `json:"resourceVersion"`
+	// Object is the serialized object, held as a string so the item stays
+	// comparable and can be used as a workqueue key.
+	Object   string `json:"object,omitempty"`
+	Attempts int    `json:"attempts"`
+	// EnqueuedAt is when the item was first enqueued, preserved across a
+	// Persist/Pending round-trip so the shadow_write_lag_seconds metric
+	// reflects true end-to-end age even for an item reloaded after an
+	// apiserver restart.
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+}
+
+func (i shadowWriteItem) key() string {
+	return fmt.Sprintf("%s/%s/%s", i.Kind, i.Namespace, i.Name)
+}
+
+// ShadowWriteStore persists queued shadow writes so they survive apiserver
+// restarts, and records items that have exhausted their retries so they
+// can be inspected and replayed out of band. Implementations are expected
+// to share the SQL store used by sqlstash.
+type ShadowWriteStore interface {
+	// Persist durably records item before it is handed to a worker.
+	Persist(ctx context.Context, item shadowWriteItem) error
+	// Complete removes item from the persisted queue once it has been
+	// applied to Storage successfully.
+	Complete(ctx context.Context, id string) error
+	// DeadLetter records item as permanently failed after it has
+	// exhausted maxShadowWriteAttempts.
+	DeadLetter(ctx context.Context, item shadowWriteItem, lastErr error) error
+	// Pending returns every item that has been Persisted but not yet
+	// Completed or DeadLettered. ShadowWriteQueue.Start calls this once,
+	// on construction, to reload the in-memory workqueue with whatever
+	// was left in flight by a previous process -- without it, a shadow
+	// write durably persisted before an apiserver restart would still be
+	// lost, because the workqueue itself is in-memory only.
+	Pending(ctx context.Context) ([]shadowWriteItem, error)
+}
+
+// ShadowWriteQueue is a persistent, rate-limited work queue that drains
+// shadow writes against Storage on behalf of DualWriterMode1 and
+// DualWriterModeCompare; DualWriterMode2 does not write through it. It
+// replaces firing a naked `go func()` per request: items are enqueued
+// durably, a pool of workers retries failures with exponential backoff,
+// and items that repeatedly fail are parked in a dead letter table
+// instead of being silently dropped.
+type ShadowWriteQueue struct {
+	storage Storage
+	store   ShadowWriteStore
+	log     klog.Logger
+	metrics *dualWriterMetrics
+
+	queue   workqueue.RateLimitingInterface
+	workers int
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewShadowWriteQueue builds a queue that drains into storage, persisting
+// and recovering items through store. workers controls how many goroutines
+// process items concurrently. Construct one queue per Storage and pass it
+// to every DualWriterMode1/ModeCompare instance wrapping that
+// Storage (via NewDualWriterMode1/NewDualWriterModeCompare) instead of
+// building a queue per instance, so every Kind drains through the same
+// bounded worker pool rather than each getting its own.
+func NewShadowWriteQueue(storage Storage, store ShadowWriteStore, workers int, metrics *dualWriterMetrics) *ShadowWriteQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	return &ShadowWriteQueue{
+		storage: storage,
+		store:   store,
+		log:     klog.NewKlogr().WithName("ShadowWriteQueue"),
+		metrics: metrics,
+		queue: workqueue.NewRateLimitingQueueWithConfig(
+			workqueue.DefaultControllerRateLimiter(),
+			workqueue.RateLimitingQueueConfig{Name: "dualwriter_shadow_writes"},
+		),
+		workers: workers,
+	}
+}
+
+// Start reloads any shadow writes store still has Pending from a previous
+// process, then spawns the worker pool. It returns immediately; workers
+// run until Stop is called. Start is idempotent -- every
+// DualWriterMode1/ModeCompare instance sharing this queue calls it
+// on construction, and only the first call has any effect -- so callers
+// don't need to coordinate who starts the shared queue. The queue's
+// worker pool runs on its own background lifetime, independent of any
+// single DualWriter's lifecycle, so one Mode instance being Destroyed
+// does not stop shadow writes for every other instance sharing the queue;
+// whoever constructs the shared queue owns calling Stop for it, typically
+// at apiserver shutdown.
+func (q *ShadowWriteQueue) Start() {
+	q.startOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		q.cancel = cancel
+		q.done = make(chan struct{})
+
+		if q.store != nil {
+			pending, err := q.store.Pending(ctx)
+			if err != nil {
+				q.log.Error(err, "unable to reload pending shadow writes on startup")
+			}
+			for _, item := range pending {
+				q.queue.Add(item)
+			}
+			if len(pending) > 0 {
+				q.log.Info("reloaded pending shadow writes from a previous process", "count", len(pending))
+			}
+		}
+
+		go func() {
+			defer close(q.done)
+			workerDone := make(chan struct{}, q.workers)
+			for i := 0; i < q.workers; i++ {
+				go func() {
+					defer func() { workerDone <- struct{}{} }()
+					q.runWorker(ctx)
+				}()
+			}
+			<-ctx.Done()
+			q.queue.ShutDown()
+			for i := 0; i < q.workers; i++ {
+				<-workerDone
+			}
+		}()
+	})
+}
+
+// Stop drains in-flight work and blocks until every worker has returned.
+// It is idempotent.
+func (q *ShadowWriteQueue) Stop() {
+	q.stopOnce.Do(func() {
+		if q.cancel == nil {
+			return
+		}
+		// Let items already being applied finish before the workers'
+		// context is canceled.
+		q.queue.ShutDownWithDrain()
+		q.cancel()
+		<-q.done
+	})
+}
+
+// Enqueue persists item and schedules it for processing. The caller's
+// context is only used to persist the item; processing happens on the
+// queue's own lifetime so it is not canceled when the request returns.
+func (q *ShadowWriteQueue) Enqueue(ctx context.Context, item shadowWriteItem) error {
+	if item.EnqueuedAt.IsZero() {
+		item.EnqueuedAt = time.Now().UTC()
+	}
+	if q.store != nil {
+		if err := q.store.Persist(ctx, item); err != nil {
+			return fmt.Errorf("persist shadow write: %w", err)
+		}
+	}
+	if q.metrics != nil {
+		q.metrics.recordShadowQueueDepth(item.Kind, float64(q.queue.Len()+1))
+	}
+	q.queue.Add(item)
+	return nil
+}
+
+// EnqueueObject is a convenience wrapper that serializes obj before
+// enqueueing a create/update/delete item.
+func (q *ShadowWriteQueue) EnqueueObject(ctx context.Context, op shadowWriteOp, kind, namespace, name, resourceVersion string, obj runtime.Object) error {
+	var raw []byte
+	if obj != nil {
+		var err error
+		raw, err = json.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("marshal shadow write object: %w", err)
+		}
+	}
+	return q.Enqueue(ctx, shadowWriteItem{
+		ID:              fmt.Sprintf("%s/%s/%s@%s", kind, namespace, name, resourceVersion),
+		Op:              op,
+		Kind:            kind,
+		Namespace:       namespace,
+		Name:            name,
+		ResourceVersion: resourceVersion,
+		Object:          string(raw),
+	})
+}
+
+func (q *ShadowWriteQueue) runWorker(ctx context.Context) {
+	for q.processNext(ctx) {
+	}
+}
+
+// shadowWriteItemBudget bounds how long a single item may take against
+// Storage, independent of the queue's own lifetime, so one stuck call
+// cannot block a worker forever.
+const shadowWriteItemBudget = 10 * time.Second
+
+// shadowWriteRetryBaseDelay is the delay before an item's first retry; it
+// doubles with every further failed attempt.
+const shadowWriteRetryBaseDelay = 5 * time.Millisecond
+
+func (q *ShadowWriteQueue) processNext(ctx context.Context) bool {
+	obj, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(obj)
+
+	item, ok := obj.(shadowWriteItem)
+	if !ok {
+		q.queue.Forget(obj)
+		return true
+	}
+
+	if q.metrics != nil {
+		q.metrics.recordShadowWriteLag(item.Kind, time.Since(item.EnqueuedAt))
+	}
+
+	itemCtx, cancel := context.WithTimeoutCause(ctx, shadowWriteItemBudget, fmt.Errorf("shadow write %s timeout", item.Op))
+	defer cancel()
+
+	start := time.Now().UTC()
+	err := q.apply(itemCtx, item)
+	recordShadowWriteCanceled(err, true)
+	if q.metrics != nil {
+		q.metrics.recordStorageDuration(err != nil, mode, item.Kind, string(item.Op), start)
+	}
+	if err == nil {
+		q.queue.Forget(obj)
+		if q.store != nil {
+			if cErr := q.store.Complete(ctx, item.ID); cErr != nil {
+				q.log.Error(cErr, "unable to mark shadow write complete", "key", item.key())
+			}
+		}
+		return true
+	}
+
+	item.Attempts++
+	if item.Attempts >= maxShadowWriteAttempts {
+		q.log.Error(err, "shadow write exhausted retries, parking in dead letter", "key", item.key(), "attempts", item.Attempts)
+		if q.metrics != nil {
+			q.metrics.recordShadowWriteDeadLettered(item.Kind)
+		}
+		if q.store != nil {
+			if dErr := q.store.DeadLetter(ctx, item, err); dErr != nil {
+				q.log.Error(dErr, "unable to persist dead letter entry", "key", item.key())
+			}
+		}
+		q.queue.Forget(obj)
+		return true
+	}
+
+	q.log.Error(err, "shadow write failed, will retry with backoff", "key", item.key(), "attempts", item.Attempts)
+	if q.metrics != nil {
+		q.metrics.recordShadowWriteRetry(item.Kind)
+	}
+	// Attempts is part of the item's value, so the workqueue's per-item
+	// rate limiter would see every retry as a first failure; the
+	// exponential delay is derived from Attempts instead.
+	q.queue.AddAfter(item, shadowWriteRetryBaseDelay<<(item.Attempts-1))
+	return true
+}
+
+// shadowObjectInfo adapts an already-resolved runtime.Object into a
+// rest.UpdatedObjectInfo so queued items can be replayed through
+// Storage.Update without re-running admission against the original
+// request's UpdatedObjectInfo.
+type shadowObjectInfo struct {
+	obj runtime.Object
+}
+
+func (s shadowObjectInfo) Preconditions() *metav1.Preconditions { return nil }
+
+func (s shadowObjectInfo) UpdatedObject(_ context.Context, _ runtime.Object) (runtime.Object, error) {
+	return s.obj, nil
+}
+
+func (q *ShadowWriteQueue) apply(ctx context.Context, item shadowWriteItem) error {
+	switch item.Op {
+	case shadowWriteDelete:
+		_, _, err := q.storage.Delete(ctx, item.Name, nil, &metav1.DeleteOptions{})
+		return err
+	case shadowWriteCreate, shadowWriteUpdate:
+		obj := q.storage.New()
+		if len(item.Object) > 0 {
+			if err := json.Unmarshal([]byte(item.Object), obj); err != nil {
+				return fmt.Errorf("unmarshal shadow write object: %w", err)
+			}
+		}
+		// Stamp the object actually landing in Storage with the annotation
+		// the reconciler's repair() anchors its three-way merge on, using
+		// item.Object (the Legacy-resolved object Create/Update enqueued)
+		// as the applied snapshot -- the same convention repair() itself
+		// uses. Without this, the first drift event for any object has no
+		// baseline to merge against and repair falls back to a blind
+		// Legacy-wins overwrite.
+		if err := setLastAppliedAnnotation(obj, []byte(item.Object)); err != nil {
+			return fmt.Errorf("stamp last-applied annotation: %w", err)
+		}
+		if item.Op == shadowWriteCreate {
+			_, err := q.storage.Create(ctx, obj, nil, &metav1.CreateOptions{})
+			return err
+		}
+		_, err := guaranteedUpdate(ctx, q.storage, item.Name, item.Kind, defaultGuaranteedUpdateRetries, func(_ context.Context, current runtime.Object) (runtime.Object, error) {
+			currentAccessor, err := meta.Accessor(current)
+			if err != nil {
+				return nil, err
+			}
+			desiredAccessor, err := meta.Accessor(obj)
+			if err != nil {
+				return nil, err
+			}
+			desiredAccessor.SetResourceVersion(currentAccessor.GetResourceVersion())
+			desiredAccessor.SetUID(currentAccessor.GetUID())
+			return obj, nil
+		})
+		return err
+	default:
+		return fmt.Errorf("unknown shadow write op %q", item.Op)
+	}
+}
+
+var _ rest.UpdatedObjectInfo = shadowObjectInfo{}
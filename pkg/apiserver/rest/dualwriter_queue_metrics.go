@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	shadowQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "dualwriter",
+		Name:      "shadow_queue_depth",
+		Help:      "Length of the shared shadow write queue, sampled each time an item of this kind is enqueued.",
+	}, []string{"kind"})
+
+	shadowWriteRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dualwriter",
+		Name:      "shadow_write_retries_total",
+		Help:      "Number of shadow writes retried after a failed attempt against Storage, by kind.",
+	}, []string{"kind"})
+
+	shadowWriteDeadLetteredTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dualwriter",
+		Name:      "shadow_write_dead_lettered_total",
+		Help:      "Number of shadow writes parked in the dead letter table after exhausting retries, by kind.",
+	}, []string{"kind"})
+
+	shadowWriteLagSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "dualwriter",
+		Name:      "shadow_write_lag_seconds",
+		Help:      "Seconds between a shadow write being enqueued and a worker picking it up for processing, by kind.",
+	}, []string{"kind"})
+)
+
+// recordShadowQueueDepth reports depth, the length of the whole shared
+// shadow write queue, under kind's label, alongside the existing
+// legacy/storage duration metrics. It is called on enqueue only, so the
+// gauge is not lowered as workers drain the queue.
+func (m *dualWriterMetrics) recordShadowQueueDepth(kind string, depth float64) {
+	shadowQueueDepth.WithLabelValues(kind).Set(depth)
+}
+
+func (m *dualWriterMetrics) recordShadowWriteRetry(kind string) {
+	shadowWriteRetriesTotal.WithLabelValues(kind).Inc()
+}
+
+func (m *dualWriterMetrics) recordShadowWriteDeadLettered(kind string) {
+	shadowWriteDeadLetteredTotal.WithLabelValues(kind).Inc()
+}
+
+// recordShadowWriteLag reports how long an item sat in the queue before a
+// worker picked it up, alongside the queue depth/retry/dead-letter
+// metrics, so operators can distinguish a deep-but-fast-draining queue
+// from one that is falling behind.
+func (m *dualWriterMetrics) recordShadowWriteLag(kind string, lag time.Duration) {
+	shadowWriteLagSeconds.WithLabelValues(kind).Set(lag.Seconds())
+}
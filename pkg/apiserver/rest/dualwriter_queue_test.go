@@ -0,0 +1,144 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShadowWriteItemKey(t *testing.T) {
+	item := shadowWriteItem{Kind: "Dashboard", Namespace: "ns", Name: "name"}
+	if got, want := item.key(), "Dashboard/ns/name"; got != want {
+		t.Fatalf("key() = %q, want %q", got, want)
+	}
+}
+
+func TestShadowWriteQueueEnqueuePersistsAndStampsEnqueuedAt(t *testing.T) {
+	store := &fakeShadowWriteStore{}
+	metrics := &dualWriterMetrics{}
+	metrics.init()
+	q := NewShadowWriteQueue(newFakeStorage(), store, 1, metrics)
+
+	before := time.Now().UTC()
+	if err := q.Enqueue(context.Background(), shadowWriteItem{ID: "a", Kind: "Dashboard"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	persisted, ok := store.persisted["a"]
+	if !ok {
+		t.Fatalf("item was not persisted")
+	}
+	if persisted.EnqueuedAt.Before(before) {
+		t.Fatalf("EnqueuedAt not stamped: got %v, want >= %v", persisted.EnqueuedAt, before)
+	}
+	if got := q.queue.Len(); got != 1 {
+		t.Fatalf("queue.Len() = %d, want 1", got)
+	}
+}
+
+// TestShadowWriteQueueStartReloadsPendingItems is a regression test for a
+// shadow write surviving an apiserver restart: Start must reload whatever
+// store.Pending still has in flight into the in-memory workqueue, not just
+// rely on newly Enqueued items.
+func TestShadowWriteQueueStartReloadsPendingItems(t *testing.T) {
+	pending := shadowWriteItem{ID: "pending-1", Op: shadowWriteCreate, Kind: "Dashboard", Name: "a"}
+	store := &fakeShadowWriteStore{pending: []shadowWriteItem{pending}}
+	storage := newFakeStorage()
+	q := NewShadowWriteQueue(storage, store, 1, nil)
+
+	q.Start()
+	defer q.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		store.mu.Lock()
+		done := len(store.completed) == 1
+		store.mu.Unlock()
+		if done {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pending item from a previous process was never reloaded and processed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestShadowWriteQueueStartIsIdempotent is a regression test for the
+// queue being shared across multiple DualWriter instances: calling Start
+// more than once must not spawn a second worker pool or reload Pending
+// items twice.
+func TestShadowWriteQueueStartIsIdempotent(t *testing.T) {
+	store := &fakeShadowWriteStore{pending: []shadowWriteItem{{ID: "pending-1", Op: shadowWriteCreate, Kind: "Dashboard", Name: "a"}}}
+	q := NewShadowWriteQueue(newFakeStorage(), store, 1, nil)
+
+	q.Start()
+	q.Start()
+	q.Start()
+	defer q.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		store.mu.Lock()
+		completed := len(store.completed)
+		store.mu.Unlock()
+		if completed == 1 {
+			return
+		}
+		if completed > 1 {
+			t.Fatalf("pending item was processed %d times, want exactly once", completed)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pending item was never processed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestShadowWriteQueueProcessNextDeadLettersAfterMaxAttempts(t *testing.T) {
+	storage := newFakeStorage()
+	storage.createErr = errors.New("create always fails")
+	store := &fakeShadowWriteStore{}
+	metrics := &dualWriterMetrics{}
+	metrics.init()
+	q := NewShadowWriteQueue(storage, store, 1, metrics)
+
+	item := shadowWriteItem{ID: "x", Op: shadowWriteCreate, Kind: "Dashboard", Name: "a", Attempts: maxShadowWriteAttempts - 1}
+	q.queue.Add(item)
+
+	if more := q.processNext(context.Background()); !more {
+		t.Fatalf("processNext returned false unexpectedly")
+	}
+	if len(store.deadLettered) != 1 {
+		t.Fatalf("expected item to be dead-lettered, got %d dead letters", len(store.deadLettered))
+	}
+}
+
+func TestShadowWriteQueueProcessNextRetriesThenSucceeds(t *testing.T) {
+	storage := newFakeStorage()
+	storage.failNextCreates = 1
+	store := &fakeShadowWriteStore{}
+	metrics := &dualWriterMetrics{}
+	metrics.init()
+	q := NewShadowWriteQueue(storage, store, 1, metrics)
+
+	item := shadowWriteItem{ID: "y", Op: shadowWriteCreate, Kind: "Dashboard", Name: "a"}
+	q.queue.Add(item)
+
+	// First attempt fails and is rescheduled with backoff.
+	if more := q.processNext(context.Background()); !more {
+		t.Fatalf("processNext returned false unexpectedly")
+	}
+	if len(store.deadLettered) != 0 {
+		t.Fatalf("item was dead-lettered after a single failure")
+	}
+
+	// Second attempt, after the rate limiter's backoff elapses, succeeds.
+	if more := q.processNext(context.Background()); !more {
+		t.Fatalf("processNext returned false unexpectedly")
+	}
+	if len(store.completed) != 1 {
+		t.Fatalf("expected item to complete after retry, got %d completions", len(store.completed))
+	}
+}
@@ -0,0 +1,327 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/klog/v2"
+)
+
+// lastDualWriterAppliedAnnotation stores the serialized object that was
+// last written through the dual writer, so the reconciler can compute a
+// three-way merge between it, the current Legacy object, and the current
+// Storage object.
+const lastDualWriterAppliedAnnotation = "grafana.app/last-dualwriter-applied"
+
+var (
+	dualwriterDriftMissing = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dualwriter",
+		Name:      "drift_missing_total",
+		Help:      "Number of objects present in Legacy but missing from Storage, by kind.",
+	}, []string{"kind"})
+
+	dualwriterDriftExtra = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dualwriter",
+		Name:      "drift_extra_total",
+		Help:      "Number of objects present in Storage but missing from Legacy, by kind.",
+	}, []string{"kind"})
+
+	dualwriterDriftMismatch = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dualwriter",
+		Name:      "drift_mismatch_total",
+		Help:      "Number of objects present in both stores whose content diverges, by kind.",
+	}, []string{"kind"})
+
+	dualwriterLastReconciled = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "dualwriter",
+		Name:      "last_reconciled_timestamp_seconds",
+		Help:      "Unix timestamp of the last completed reconciliation pass, by kind.",
+	}, []string{"kind"})
+)
+
+// Reconciler periodically compares LegacyStorage and Storage for a single
+// Kind and repairs divergence. DualWriterMode1 holds one per Kind
+// (selected via a per-Kind allow-list, see WithReconciler) and runs it for
+// as long as the dual writer itself is alive; DualWriterMode2 takes none.
+type Reconciler interface {
+	// Reconcile runs a single list-and-diff pass. It is safe to call
+	// repeatedly; Run calls it on Interval until ctx is canceled.
+	Reconcile(ctx context.Context) error
+	// Interval is how often Run invokes Reconcile.
+	Interval() time.Duration
+	// Run blocks, calling Reconcile on Interval until ctx is canceled.
+	Run(ctx context.Context)
+}
+
+// ReconcilerConfig controls a driftReconciler's behavior.
+type ReconcilerConfig struct {
+	// Kind is the label used on drift metrics and log lines.
+	Kind string
+	// Interval is how often the reconciler lists both stores.
+	Interval time.Duration
+	// Repair, when true, attempts to patch Storage towards Legacy when
+	// drift is found. When false the reconciler only records metrics.
+	Repair bool
+}
+
+// driftReconciler is the default Reconciler: it lists LegacyStorage and
+// Storage for a single Kind, diffs them by name, and optionally repairs
+// Storage using a three-way merge driven by lastDualWriterAppliedAnnotation.
+type driftReconciler struct {
+	legacy  LegacyStorage
+	storage Storage
+	cfg     ReconcilerConfig
+	log     klog.Logger
+}
+
+// NewDriftReconciler builds a Reconciler for a single Kind. legacy and
+// storage are typically the same LegacyStorage/Storage pair handed to
+// NewDualWriterMode1/Mode2.
+func NewDriftReconciler(legacy LegacyStorage, storage Storage, cfg ReconcilerConfig) Reconciler {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Minute
+	}
+	return &driftReconciler{
+		legacy:  legacy,
+		storage: storage,
+		cfg:     cfg,
+		log:     klog.NewKlogr().WithName("DualWriterReconciler").WithValues("kind", cfg.Kind),
+	}
+}
+
+func (r *driftReconciler) Interval() time.Duration { return r.cfg.Interval }
+
+func (r *driftReconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reconcile(ctx); err != nil {
+				r.log.Error(err, "reconciliation pass failed")
+			}
+		}
+	}
+}
+
+func (r *driftReconciler) Reconcile(ctx context.Context) error {
+	legacyList, err := r.legacy.List(ctx, &metainternalversion.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list legacy: %w", err)
+	}
+	storageList, err := r.storage.List(ctx, &metainternalversion.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list storage: %w", err)
+	}
+
+	legacyByName, err := indexByName(legacyList)
+	if err != nil {
+		return fmt.Errorf("index legacy list: %w", err)
+	}
+	storageByName, err := indexByName(storageList)
+	if err != nil {
+		return fmt.Errorf("index storage list: %w", err)
+	}
+
+	for name, legacyObj := range legacyByName {
+		storageObj, ok := storageByName[name]
+		if !ok {
+			dualwriterDriftMissing.WithLabelValues(r.cfg.Kind).Inc()
+			r.log.Info("object missing from storage", "name", name)
+			if r.cfg.Repair {
+				if err := r.repair(ctx, name, legacyObj, nil); err != nil {
+					r.log.Error(err, "unable to repair missing object", "name", name)
+				}
+			}
+			continue
+		}
+		if !objectsEqualIgnoringVolatileFields(legacyObj, storageObj) {
+			dualwriterDriftMismatch.WithLabelValues(r.cfg.Kind).Inc()
+			r.log.Info("object diverges between legacy and storage", "name", name)
+			if r.cfg.Repair {
+				if err := r.repair(ctx, name, legacyObj, storageObj); err != nil {
+					r.log.Error(err, "unable to repair mismatched object", "name", name)
+				}
+			}
+		}
+	}
+
+	for name := range storageByName {
+		if _, ok := legacyByName[name]; !ok {
+			dualwriterDriftExtra.WithLabelValues(r.cfg.Kind).Inc()
+			r.log.Info("object present in storage but not legacy", "name", name)
+		}
+	}
+
+	dualwriterLastReconciled.WithLabelValues(r.cfg.Kind).SetToCurrentTime()
+	return nil
+}
+
+// repair computes a two-way strategic merge patch between the
+// lastDualWriterAppliedAnnotation recorded on storageObj and the current
+// legacyObj, applies it to storageObj, and PUTs the result using
+// storageObj's resourceVersion as a precondition so a concurrent writer
+// still triggers a 409 and the next pass retries.
+func (r *driftReconciler) repair(ctx context.Context, name string, legacyObj, storageObj runtime.Object) error {
+	base := storageObj
+	if base == nil {
+		base = r.storage.New()
+	}
+
+	legacyJSON, err := json.Marshal(legacyObj)
+	if err != nil {
+		return fmt.Errorf("marshal legacy object: %w", err)
+	}
+	baseJSON, err := json.Marshal(base)
+	if err != nil {
+		return fmt.Errorf("marshal storage object: %w", err)
+	}
+
+	desiredJSON := legacyJSON
+	if original, ok := lastAppliedFromAnnotation(base); ok {
+		patch, err := strategicpatch.CreateTwoWayMergePatch(original, legacyJSON, r.storage.New())
+		if err != nil {
+			return fmt.Errorf("compute merge patch: %w", err)
+		}
+		desiredJSON, err = strategicpatch.StrategicMergePatch(baseJSON, patch, r.storage.New())
+		if err != nil {
+			return fmt.Errorf("apply merge patch: %w", err)
+		}
+	}
+
+	desired := r.storage.New()
+	if err := json.Unmarshal(desiredJSON, desired); err != nil {
+		return fmt.Errorf("unmarshal repaired object: %w", err)
+	}
+
+	accessor, err := meta.Accessor(desired)
+	if err != nil {
+		return fmt.Errorf("get accessor: %w", err)
+	}
+	if storageObj != nil {
+		storageAccessor, err := meta.Accessor(storageObj)
+		if err != nil {
+			return fmt.Errorf("get storage accessor: %w", err)
+		}
+		accessor.SetResourceVersion(storageAccessor.GetResourceVersion())
+	}
+	if err := setLastAppliedAnnotation(desired, legacyJSON); err != nil {
+		return fmt.Errorf("stamp last-applied annotation: %w", err)
+	}
+
+	objInfo := shadowObjectInfo{obj: desired}
+	_, _, err = r.storage.Update(ctx, name, objInfo, nil, nil, true, &metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		r.log.Info("repair lost to a concurrent writer, will retry next pass", "name", name)
+		return nil
+	}
+	return err
+}
+
+func indexByName(list runtime.Object) (map[string]runtime.Object, error) {
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]runtime.Object, len(items))
+	for _, item := range items {
+		accessor, err := meta.Accessor(item)
+		if err != nil {
+			return nil, err
+		}
+		byName[accessor.GetName()] = item
+	}
+	return byName, nil
+}
+
+// objectsEqualIgnoringVolatileFields compares two objects after stripping
+// resourceVersion, uid and other fields that legitimately differ between
+// Legacy and Storage copies of the same object.
+func objectsEqualIgnoringVolatileFields(a, b runtime.Object) bool {
+	aStripped, errA := stripVolatileMetadata(a)
+	bStripped, errB := stripVolatileMetadata(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return string(aStripped) == string(bStripped)
+}
+
+// volatileMetadataFields are stripped before comparing two copies of the
+// same object so that fields which legitimately differ between Legacy and
+// Storage (resourceVersion, uid, managed fields, server-set timestamps)
+// don't register as drift.
+var volatileMetadataFields = []string{"resourceVersion", "uid", "managedFields", "creationTimestamp", "generation", "selfLink"}
+
+// stripVolatileMetadata marshals obj to JSON and removes volatile
+// metadata.* fields, along with the lastDualWriterAppliedAnnotation
+// bookkeeping key (present only on the Storage copy), returning a
+// canonical representation suitable for byte-for-byte comparison between
+// two copies of the same object. Real annotations are left in place so
+// that genuine annotation drift between Legacy and Storage still shows
+// up as a mismatch.
+func stripVolatileMetadata(obj runtime.Object) ([]byte, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	if metadata, ok := generic["metadata"].(map[string]interface{}); ok {
+		for _, field := range volatileMetadataFields {
+			delete(metadata, field)
+		}
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, lastDualWriterAppliedAnnotation)
+			// A copy whose only annotation was the bookkeeping key must
+			// match a copy that carries no annotations at all.
+			if len(annotations) == 0 {
+				delete(metadata, "annotations")
+			}
+		}
+	}
+	return json.Marshal(generic)
+}
+
+// lastAppliedFromAnnotation returns the serialized object recorded in
+// lastDualWriterAppliedAnnotation, if any.
+func lastAppliedFromAnnotation(obj runtime.Object) ([]byte, bool) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, false
+	}
+	raw, ok := accessor.GetAnnotations()[lastDualWriterAppliedAnnotation]
+	if !ok || raw == "" {
+		return nil, false
+	}
+	return []byte(raw), true
+}
+
+// setLastAppliedAnnotation stamps obj with appliedJSON so a future
+// reconcile pass can compute a three-way merge against it.
+func setLastAppliedAnnotation(obj runtime.Object, appliedJSON []byte) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	annotations := accessor.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[lastDualWriterAppliedAnnotation] = string(appliedJSON)
+	accessor.SetAnnotations(annotations)
+	return nil
+}
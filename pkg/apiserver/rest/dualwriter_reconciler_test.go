@@ -0,0 +1,136 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+func newTestObject(name string, annotations map[string]string) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			ResourceVersion: "1",
+			Annotations:     annotations,
+		},
+	}
+}
+
+// TestStripVolatileMetadataKeepsRealAnnotations is a regression test: only
+// lastDualWriterAppliedAnnotation should be stripped, not the whole
+// annotations map, so real annotation drift still shows up as a mismatch.
+func TestStripVolatileMetadataKeepsRealAnnotations(t *testing.T) {
+	obj := newTestObject("a", map[string]string{
+		lastDualWriterAppliedAnnotation: `{"some":"snapshot"}`,
+		"team.grafana.app/owner":        "observability",
+	})
+
+	raw, err := stripVolatileMetadata(obj)
+	if err != nil {
+		t.Fatalf("stripVolatileMetadata: %v", err)
+	}
+
+	other := newTestObject("a", map[string]string{
+		"team.grafana.app/owner": "observability",
+	})
+	otherRaw, err := stripVolatileMetadata(other)
+	if err != nil {
+		t.Fatalf("stripVolatileMetadata: %v", err)
+	}
+
+	if string(raw) != string(otherRaw) {
+		t.Fatalf("stripVolatileMetadata should ignore lastDualWriterAppliedAnnotation: got %s, want %s", raw, otherRaw)
+	}
+}
+
+func TestObjectsEqualIgnoringVolatileFieldsDetectsRealAnnotationDrift(t *testing.T) {
+	a := newTestObject("a", map[string]string{"team.grafana.app/owner": "observability"})
+	b := newTestObject("a", map[string]string{"team.grafana.app/owner": "platform"})
+
+	if objectsEqualIgnoringVolatileFields(a, b) {
+		t.Fatalf("objects with differing real annotations should not compare equal")
+	}
+}
+
+func TestObjectsEqualIgnoringVolatileFieldsIgnoresBookkeepingAndVolatileFields(t *testing.T) {
+	a := newTestObject("a", map[string]string{lastDualWriterAppliedAnnotation: `{"x":1}`})
+	a.ResourceVersion = "1"
+	a.UID = "uid-a"
+
+	b := newTestObject("a", nil)
+	b.ResourceVersion = "2"
+	b.UID = "uid-b"
+
+	if !objectsEqualIgnoringVolatileFields(a, b) {
+		t.Fatalf("objects differing only by resourceVersion/uid/bookkeeping annotation should compare equal")
+	}
+}
+
+func TestLastAppliedAnnotationRoundTrip(t *testing.T) {
+	obj := newTestObject("a", nil)
+	if _, ok := lastAppliedFromAnnotation(obj); ok {
+		t.Fatalf("expected no last-applied annotation on a fresh object")
+	}
+
+	if err := setLastAppliedAnnotation(obj, []byte(`{"hello":"world"}`)); err != nil {
+		t.Fatalf("setLastAppliedAnnotation: %v", err)
+	}
+
+	raw, ok := lastAppliedFromAnnotation(obj)
+	if !ok {
+		t.Fatalf("expected last-applied annotation after setLastAppliedAnnotation")
+	}
+	if string(raw) != `{"hello":"world"}` {
+		t.Fatalf("lastAppliedFromAnnotation = %s, want {\"hello\":\"world\"}", raw)
+	}
+}
+
+// TestDriftReconcilerRepairThreeWayMerge exercises repair's three-way
+// merge: Storage has a local annotation added after the dual writer's
+// last applied snapshot, and Legacy has changed a different field. The
+// repaired object must keep the Storage-only annotation instead of
+// clobbering it with a naive two-way Legacy-wins copy.
+func TestDriftReconcilerRepairThreeWayMerge(t *testing.T) {
+	legacy := newFakeStorage()
+	storage := newFakeStorage()
+
+	original := newTestObject("a", nil)
+	original.Labels = map[string]string{"tier": "one"}
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("marshal original: %v", err)
+	}
+
+	legacyObj := newTestObject("a", nil)
+	legacyObj.Labels = map[string]string{"tier": "two"}
+	legacy.objects["a"] = legacyObj
+
+	storageObj := newTestObject("a", map[string]string{
+		lastDualWriterAppliedAnnotation: string(originalJSON),
+		"storage-only":                  "kept",
+	})
+	storageObj.Labels = map[string]string{"tier": "one"}
+	storage.objects["a"] = storageObj
+
+	r := &driftReconciler{
+		legacy:  legacy,
+		storage: storage,
+		cfg:     ReconcilerConfig{Kind: "Dashboard", Repair: true},
+		log:     klog.NewKlogr().WithName("test"),
+	}
+
+	if err := r.repair(context.Background(), "a", legacyObj, storageObj); err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+
+	repaired := storage.objects["a"]
+	if repaired.Labels["tier"] != "two" {
+		t.Fatalf("repair did not apply legacy's field change, got tier=%q", repaired.Labels["tier"])
+	}
+	if repaired.Annotations["storage-only"] != "kept" {
+		t.Fatalf("repair clobbered a storage-only annotation not present in legacy")
+	}
+}
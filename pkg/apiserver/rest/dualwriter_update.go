@@ -0,0 +1,96 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+)
+
+// defaultGuaranteedUpdateRetries bounds how many times guaranteedUpdate
+// re-reads and re-applies tryUpdate after a resourceVersion conflict
+// before giving up, mirroring storage.Interface.GuaranteedUpdate's own
+// default retry budget.
+const defaultGuaranteedUpdateRetries = 5
+
+var dualwriterUpdateConflictRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "dualwriter",
+	Name:      "update_conflict_retries_total",
+	Help:      "Number of times a DualWriter Storage update was retried after a resourceVersion conflict, by kind.",
+}, []string{"kind"})
+
+// guaranteedUpdate loads the current object from storage, runs tryUpdate
+// against it to produce the desired state, and attempts storage.Update
+// with the observed resourceVersion as a precondition. On a 409 Conflict
+// it re-reads and re-applies tryUpdate up to maxRetries times before
+// giving up, so a concurrent write to Storage is retried against instead
+// of being silently overwritten. It mirrors the shape of
+// storage.Interface.GuaranteedUpdate and is shared by every DualWriter
+// mode that shadow-writes to Storage.
+func guaranteedUpdate(
+	ctx context.Context,
+	storage Storage,
+	name string,
+	kind string,
+	maxRetries int,
+	tryUpdate func(ctx context.Context, current runtime.Object) (runtime.Object, error),
+) (runtime.Object, error) {
+	if maxRetries <= 0 {
+		maxRetries = defaultGuaranteedUpdateRetries
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		current, err := storage.Get(ctx, name, &metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("get current object: %w", err)
+		}
+
+		desired, err := tryUpdate(ctx, current)
+		if err != nil {
+			return nil, fmt.Errorf("compute desired object: %w", err)
+		}
+
+		currentAccessor, err := meta.Accessor(current)
+		if err != nil {
+			return nil, fmt.Errorf("get accessor for current object: %w", err)
+		}
+		desiredAccessor, err := meta.Accessor(desired)
+		if err != nil {
+			return nil, fmt.Errorf("get accessor for desired object: %w", err)
+		}
+		// The observed resourceVersion on the desired object is the
+		// precondition: Storage rejects the update with a 409 if it moved.
+		desiredAccessor.SetResourceVersion(currentAccessor.GetResourceVersion())
+
+		updated, _, err := storage.Update(
+			ctx,
+			name,
+			shadowObjectInfo{obj: desired},
+			nil,
+			nil,
+			true,
+			&metav1.UpdateOptions{},
+		)
+		if err == nil {
+			return updated, nil
+		}
+
+		lastErr = err
+		if !apierrors.IsConflict(err) {
+			return nil, err
+		}
+
+		dualwriterUpdateConflictRetriesTotal.WithLabelValues(kind).Inc()
+		klog.NewKlogr().WithName("DualWriterGuaranteedUpdate").WithValues("name", name, "kind", kind, "attempt", attempt).
+			Info("storage update conflicted, re-reading and retrying")
+	}
+
+	return nil, fmt.Errorf("guaranteed update exhausted %d retries for %q: %w", maxRetries, name, lastErr)
+}
@@ -0,0 +1,67 @@
+package rest
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestGuaranteedUpdateAppliesTryUpdateOnce(t *testing.T) {
+	storage := newFakeStorage()
+	storage.objects["a"] = newTestObject("a", nil)
+
+	calls := 0
+	updated, err := guaranteedUpdate(context.Background(), storage, "a", "Dashboard", 3, func(_ context.Context, current runtime.Object) (runtime.Object, error) {
+		calls++
+		obj := current.(*metav1.PartialObjectMetadata).DeepCopy()
+		obj.Labels = map[string]string{"touched": "yes"}
+		return obj, nil
+	})
+	if err != nil {
+		t.Fatalf("guaranteedUpdate: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("tryUpdate called %d times, want 1", calls)
+	}
+	if updated.(*metav1.PartialObjectMetadata).Labels["touched"] != "yes" {
+		t.Fatalf("expected the update produced by tryUpdate to be persisted")
+	}
+}
+
+func TestGuaranteedUpdateRetriesOnConflictThenSucceeds(t *testing.T) {
+	storage := newFakeStorage()
+	storage.objects["a"] = newTestObject("a", nil)
+	storage.updateErr = apierrors.NewConflict(schema.GroupResource{Resource: "dashboards"}, "a", nil)
+
+	attempts := 0
+	_, err := guaranteedUpdate(context.Background(), storage, "a", "Dashboard", 3, func(_ context.Context, current runtime.Object) (runtime.Object, error) {
+		attempts++
+		if attempts == 2 {
+			storage.updateErr = nil
+		}
+		return current, nil
+	})
+	if err != nil {
+		t.Fatalf("guaranteedUpdate: %v", err)
+	}
+	if attempts < 2 {
+		t.Fatalf("tryUpdate called %d times, want at least 2 (one retry after the conflict)", attempts)
+	}
+}
+
+func TestGuaranteedUpdateExhaustsRetries(t *testing.T) {
+	storage := newFakeStorage()
+	storage.objects["a"] = newTestObject("a", nil)
+	storage.updateErr = apierrors.NewConflict(schema.GroupResource{Resource: "dashboards"}, "a", nil)
+
+	_, err := guaranteedUpdate(context.Background(), storage, "a", "Dashboard", 2, func(_ context.Context, current runtime.Object) (runtime.Object, error) {
+		return current, nil
+	})
+	if err == nil {
+		t.Fatalf("expected guaranteedUpdate to give up after exhausting retries")
+	}
+}
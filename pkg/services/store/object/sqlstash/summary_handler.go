@@ -12,9 +12,21 @@ type summarySupport struct {
 	labels      *string
 	fields      *string
 	errors      *string // should not allow saving with this!
+
+	// indexedFields holds the pruned Fields map so IndexedColumnValues can
+	// pull out the subset promoted to SQL columns. It does not round-trip
+	// through toObjectSummary -- the JSON in fields is still the source
+	// of truth for reads.
+	indexedFields map[string]interface{}
 }
 
-func newSummarySupport(summary *object.ObjectSummary) (summarySupport, error) {
+// newSummarySupport runs summary.Fields through kind's registered
+// structural schema -- pruning and validating it -- before marshaling,
+// and rejects writes whose Fields violate the schema instead of silently
+// serializing them. No defaulting is done: the schema declares no default
+// values, so absent optional properties stay absent. Kinds with no registered schema round-trip
+// Fields as opaque JSON exactly as before.
+func newSummarySupport(kind string, summary *object.ObjectSummary) (summarySupport, error) {
 	var err error
 	var js []byte
 	s := summarySupport{}
@@ -34,7 +46,13 @@ func newSummarySupport(summary *object.ObjectSummary) (summarySupport, error) {
 		}
 
 		if len(summary.Fields) > 0 {
-			js, err = json.Marshal(summary.Fields)
+			pruned, err := pruneAndValidateFields(kind, summary.Fields)
+			if err != nil {
+				return s, err
+			}
+			s.indexedFields = pruned
+
+			js, err = json.Marshal(pruned)
 			if err != nil {
 				return s, err
 			}
@@ -54,6 +72,25 @@ func newSummarySupport(summary *object.ObjectSummary) (summarySupport, error) {
 	return s, err
 }
 
+// IndexedColumnValues returns the generated-column-name/value pairs for
+// kind's indexed Fields properties present on s, for the SQL writer that
+// embeds this package to bind alongside the fixed name/description/
+// labels/fields/errors columns. See ColumnMigrationDDL for the other half
+// of column promotion (the DDL that adds these columns in the first
+// place).
+func (s summarySupport) IndexedColumnValues(kind string) map[string]interface{} {
+	if len(s.indexedFields) == 0 {
+		return nil
+	}
+	values := make(map[string]interface{})
+	for _, col := range IndexedColumns(kind) {
+		if v, ok := s.indexedFields[col.Name]; ok {
+			values[indexedColumnName(col.Name)] = v
+		}
+	}
+	return values
+}
+
 func (s summarySupport) toObjectSummary() (*object.ObjectSummary, error) {
 	var err error
 	summary := &object.ObjectSummary{
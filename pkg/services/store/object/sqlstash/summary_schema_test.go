@@ -0,0 +1,170 @@
+package sqlstash
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/services/store/object"
+)
+
+func TestPruneAndValidateFieldsNoSchemaReturnsUnchanged(t *testing.T) {
+	fields := map[string]interface{}{"anything": "goes"}
+	pruned, err := pruneAndValidateFields("no-such-kind", fields)
+	if err != nil {
+		t.Fatalf("pruneAndValidateFields: %v", err)
+	}
+	if pruned["anything"] != "goes" {
+		t.Fatalf("expected fields to round-trip unchanged for an unregistered kind")
+	}
+}
+
+func TestPruneAndValidateFieldsDropsUnknownFields(t *testing.T) {
+	RegisterSummarySchema("Widget", summarySchema{
+		Properties: map[string]summaryFieldDef{
+			"title": {Type: summaryFieldString},
+		},
+	})
+
+	pruned, err := pruneAndValidateFields("Widget", map[string]interface{}{
+		"title":   "hello",
+		"unknown": "dropped",
+	})
+	if err != nil {
+		t.Fatalf("pruneAndValidateFields: %v", err)
+	}
+	if _, ok := pruned["unknown"]; ok {
+		t.Fatalf("expected unknown field to be dropped")
+	}
+	if pruned["title"] != "hello" {
+		t.Fatalf("expected declared field to survive pruning")
+	}
+}
+
+func TestPruneAndValidateFieldsPreservesUnknownFieldsWhenAllowed(t *testing.T) {
+	RegisterSummarySchema("WidgetPreserve", summarySchema{
+		Properties:            map[string]summaryFieldDef{"title": {Type: summaryFieldString}},
+		PreserveUnknownFields: true,
+	})
+
+	pruned, err := pruneAndValidateFields("WidgetPreserve", map[string]interface{}{
+		"title": "hello",
+		"extra": "kept",
+	})
+	if err != nil {
+		t.Fatalf("pruneAndValidateFields: %v", err)
+	}
+	if pruned["extra"] != "kept" {
+		t.Fatalf("expected unknown field to survive when PreserveUnknownFields is set")
+	}
+}
+
+func TestPruneAndValidateFieldsRejectsMissingRequiredField(t *testing.T) {
+	RegisterSummarySchema("WidgetRequired", summarySchema{
+		Properties: map[string]summaryFieldDef{
+			"title": {Type: summaryFieldString, Required: true},
+		},
+	})
+
+	if _, err := pruneAndValidateFields("WidgetRequired", map[string]interface{}{}); err == nil {
+		t.Fatalf("expected an error for a missing required field")
+	}
+}
+
+func TestPruneAndValidateFieldsRejectsWrongType(t *testing.T) {
+	RegisterSummarySchema("WidgetTyped", summarySchema{
+		Properties: map[string]summaryFieldDef{
+			"count": {Type: summaryFieldInt64},
+		},
+	})
+
+	if _, err := pruneAndValidateFields("WidgetTyped", map[string]interface{}{"count": "not-a-number"}); err == nil {
+		t.Fatalf("expected an error for a field with the wrong type")
+	}
+}
+
+func TestIndexedColumnsReturnsOnlyIndexedFieldsSortedByName(t *testing.T) {
+	RegisterSummarySchema("WidgetIndexed", summarySchema{
+		Properties: map[string]summaryFieldDef{
+			"title":    {Type: summaryFieldString},
+			"priority": {Type: summaryFieldInt64, Indexed: true},
+			"active":   {Type: summaryFieldBool, Indexed: true},
+		},
+	})
+
+	cols := IndexedColumns("WidgetIndexed")
+	if len(cols) != 2 {
+		t.Fatalf("len(cols) = %d, want 2", len(cols))
+	}
+	if cols[0].Name != "active" || cols[1].Name != "priority" {
+		t.Fatalf("expected cols sorted by name, got %+v", cols)
+	}
+	if cols[1].SQLType != "BIGINT" {
+		t.Fatalf("priority SQLType = %q, want BIGINT", cols[1].SQLType)
+	}
+}
+
+func TestColumnMigrationDDLGeneratesAddColumnAndIndexPerIndexedField(t *testing.T) {
+	RegisterSummarySchema("WidgetDDL", summarySchema{
+		Properties: map[string]summaryFieldDef{
+			"priority": {Type: summaryFieldInt64, Indexed: true},
+		},
+	})
+
+	stmts := ColumnMigrationDDL("object_summary", "WidgetDDL")
+	if len(stmts) != 2 {
+		t.Fatalf("len(stmts) = %d, want 2", len(stmts))
+	}
+	if stmts[0] != "ALTER TABLE object_summary ADD COLUMN IF NOT EXISTS summary_priority BIGINT" {
+		t.Fatalf("unexpected ALTER TABLE statement: %s", stmts[0])
+	}
+	if stmts[1] != "CREATE INDEX IF NOT EXISTS object_summary_summary_priority_idx ON object_summary (summary_priority)" {
+		t.Fatalf("unexpected CREATE INDEX statement: %s", stmts[1])
+	}
+}
+
+func TestIndexedFilterColumnFallsBackForUnpromotedFields(t *testing.T) {
+	RegisterSummarySchema("WidgetFilter", summarySchema{
+		Properties: map[string]summaryFieldDef{
+			"priority": {Type: summaryFieldInt64, Indexed: true},
+			"title":    {Type: summaryFieldString},
+		},
+	})
+
+	if col, ok := IndexedFilterColumn("WidgetFilter", "priority"); !ok || col != "summary_priority" {
+		t.Fatalf("IndexedFilterColumn(priority) = (%q, %v), want (summary_priority, true)", col, ok)
+	}
+	if _, ok := IndexedFilterColumn("WidgetFilter", "title"); ok {
+		t.Fatalf("expected a non-indexed field to report ok=false")
+	}
+}
+
+func TestValidateFieldTypeAcceptsNumericKinds(t *testing.T) {
+	for _, v := range []interface{}{float64(1), int(1), int64(1)} {
+		if err := validateFieldType("count", summaryFieldInt64, v); err != nil {
+			t.Fatalf("validateFieldType(%T) = %v, want nil", v, err)
+		}
+	}
+}
+
+func TestSummarySupportIndexedColumnValuesReturnsOnlyPromotedFields(t *testing.T) {
+	RegisterSummarySchema("WidgetColumnValues", summarySchema{
+		Properties: map[string]summaryFieldDef{
+			"priority": {Type: summaryFieldInt64, Indexed: true},
+			"title":    {Type: summaryFieldString},
+		},
+	})
+
+	s, err := newSummarySupport("WidgetColumnValues", &object.ObjectSummary{
+		Fields: map[string]interface{}{"priority": float64(3), "title": "hello"},
+	})
+	if err != nil {
+		t.Fatalf("newSummarySupport: %v", err)
+	}
+
+	values := s.IndexedColumnValues("WidgetColumnValues")
+	if len(values) != 1 {
+		t.Fatalf("len(values) = %d, want 1", len(values))
+	}
+	if values["summary_priority"] != float64(3) {
+		t.Fatalf("values[summary_priority] = %v, want 3", values["summary_priority"])
+	}
+}